@@ -0,0 +1,200 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"sync"
+
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// Client holds everything needed to build and transmit Events to Honeycomb:
+// its own Config, transmission queue, and Responses channel. Applications
+// that only need a single pipeline can ignore Client entirely and use the
+// package-level functions (Init, NewEvent, SendNow, ...), which operate on a
+// default Client created automatically at package load time.
+//
+// Additional Clients, created with NewClient, are useful for library code
+// that doesn't want to fight the host application for the one global queue,
+// or for tests that want to assert on what got sent without redirecting
+// (and resetting) global state.
+type Client struct {
+	config Config
+
+	Output    Output
+	responses chan Response
+
+	// state is the Builder that holds this Client's default static and
+	// dynamic fields; NewEvent and NewBuilder are derived from it.
+	state *Builder
+
+	sd *statsd.Client
+
+	startOnce sync.Once
+	startErr  error
+}
+
+// NewClient creates a new Client from the given Config. All fields in Config
+// are optional; if WriteKey and Dataset are absent, they must be set later
+// on a Builder or Event created from this Client.
+func NewClient(config Config) (*Client, error) {
+	c := newClient(config)
+
+	// statsd.New probes for a local statsd agent and errors if none is
+	// listening, which is the common case; fall back to a mute client
+	// rather than making that a hard failure of NewClient/Init.
+	c.sd, _ = statsd.New(statsd.Prefix("libhoney"))
+
+	if err := c.ensureStarted(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ensureStarted starts this Client's Output the first time it's called,
+// and is a no-op (returning the original result) on every call after that.
+// It's safe to call concurrently. NewClient calls this immediately so that
+// a Client an application explicitly asked for reports a broken transport
+// up front; newDefaultClient does not, so that the Client backing the
+// package-level functions doesn't start a real transmission loop until
+// something actually sends through it.
+func (c *Client) ensureStarted() error {
+	c.startOnce.Do(func() {
+		c.startErr = c.Output.Start()
+	})
+	return c.startErr
+}
+
+// newClient builds a Client from config, filling in defaults, but does not
+// start its transmission client or set up a real statsd connection. It is
+// shared by NewClient and newDefaultClient so that using libhoney without
+// calling Init() still produces a usable, if minimally configured, Client
+// rather than a nil pointer.
+func newClient(config Config) *Client {
+	if config.SampleRate == 0 {
+		config.SampleRate = defaultSampleRate
+	}
+	if config.APIHost == "" {
+		config.APIHost = defaultAPIHost
+	}
+	if config.Sampler == nil {
+		config.Sampler = deterministicSampler{}
+	}
+	if config.PendingWorkCapacity == 0 {
+		config.PendingWorkCapacity = defaultPendingWorkCapacity
+	}
+	if config.MaxBatchSize == 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
+	if config.SendFrequency == 0 {
+		config.SendFrequency = defaultBatchTimeout
+	}
+	if config.MaxConcurrentBatches == 0 {
+		config.MaxConcurrentBatches = defaultMaxConcurrentBatches
+	}
+
+	c := &Client{
+		config:    config,
+		responses: make(chan Response, config.PendingWorkCapacity*2),
+	}
+
+	if config.Output != nil {
+		c.Output = config.Output
+	} else {
+		c.Output = &txDefaultClient{
+			maxBatchSize:         config.MaxBatchSize,
+			batchTimeout:         config.SendFrequency,
+			maxConcurrentBatches: config.MaxConcurrentBatches,
+			pendingWorkCapacity:  config.PendingWorkCapacity,
+			blockOnSend:          config.BlockOnSend,
+			httpClient:           config.HTTPClient,
+			transport:            config.Transport,
+			client:               c,
+		}
+	}
+
+	c.state = &Builder{
+		WriteKey:   config.WriteKey,
+		Dataset:    config.Dataset,
+		SampleRate: config.SampleRate,
+		APIHost:    config.APIHost,
+		Sampler:    config.Sampler,
+		dynFields:  make([]dynamicField, 0, 0),
+		client:     c,
+	}
+	c.state.data = make(map[string]interface{})
+
+	return c
+}
+
+// newDefaultClient builds the Client backing the package-level functions
+// before (or absent a call to) Init(). It must never fail: using libhoney
+// without calling Init should behave sensibly, not panic. Its Output is not
+// started here -- see ensureStarted -- so merely importing the package
+// doesn't spin up a live transmission loop that nothing will ever use.
+func newDefaultClient() *Client {
+	c := newClient(Config{})
+	c.sd, _ = statsd.New(statsd.Mute(true))
+	return c
+}
+
+// NewEvent creates a new Event prepopulated with any fields present in this
+// Client's global scope.
+func (c *Client) NewEvent() *Event {
+	return c.state.NewEvent()
+}
+
+// NewBuilder creates a new Builder that inherits this Client's default
+// static and dynamic fields.
+func (c *Client) NewBuilder() *Builder {
+	return c.state.Clone()
+}
+
+// SendNow is a shortcut to create an Event on this Client, add data to it,
+// and send it.
+func (c *Client) SendNow(data interface{}) error {
+	ev := c.NewEvent()
+	if err := ev.Add(data); err != nil {
+		return err
+	}
+	return ev.Send()
+}
+
+// Responses returns the channel from which the caller can read the
+// responses to Events sent through this Client.
+func (c *Client) Responses() chan Response {
+	return c.responses
+}
+
+// AddField adds a field to this Client's global scope. It will be inherited
+// by every Builder and Event subsequently created from this Client.
+func (c *Client) AddField(name string, val interface{}) {
+	c.state.AddField(name, val)
+}
+
+// AddDynamicField adds a dynamic field to this Client's global scope. See
+// Builder.AddDynamicField for details.
+func (c *Client) AddDynamicField(name string, fn func() interface{}) error {
+	return c.state.AddDynamicField(name, fn)
+}
+
+// Add adds its data to this Client's global scope. See fieldHolder.Add for
+// details on what types of data are accepted.
+func (c *Client) Add(data interface{}) error {
+	return c.state.Add(data)
+}
+
+// Close waits for all in-flight messages sent through this Client to be
+// sent, then closes its Responses channel. You should Close every Client
+// you create before your application exits.
+func (c *Client) Close() {
+	// A Client whose Output was never started (e.g. a default Client that
+	// never sent an event) has no transport to stop; ensureStarted makes
+	// that true either way, so Stop always has a running Output to close.
+	c.ensureStarted()
+	c.Output.Stop()
+	close(c.responses)
+}
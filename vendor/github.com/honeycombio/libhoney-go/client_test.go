@@ -0,0 +1,113 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"sync"
+	"testing"
+)
+
+// recordingOutput is an Output that just counts Start/Stop calls, so tests
+// can assert on whether (and how many times) a Client's transport was
+// actually started without spinning up a real transmission loop.
+type recordingOutput struct {
+	mu               sync.Mutex
+	started, stopped int
+}
+
+func (r *recordingOutput) Add(ev *Event) {}
+
+func (r *recordingOutput) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started++
+	return nil
+}
+
+func (r *recordingOutput) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped++
+	return nil
+}
+
+func (r *recordingOutput) counts() (started, stopped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.started, r.stopped
+}
+
+func TestNewClientStartsOutputImmediately(t *testing.T) {
+	out := &recordingOutput{}
+	c, err := NewClient(Config{WriteKey: "wk", Dataset: "ds", Output: out})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	if started, _ := out.counts(); started != 1 {
+		t.Errorf("got %d Start calls from NewClient, want 1", started)
+	}
+}
+
+func TestDefaultClientDoesNotStartOutputUntilSend(t *testing.T) {
+	c := newDefaultClient()
+	out := &recordingOutput{}
+	c.Output = out
+
+	if started, _ := out.counts(); started != 0 {
+		t.Fatalf("got %d Start calls on construction alone, want 0 -- "+
+			"importing the package must not start a live transmission loop", started)
+	}
+
+	ev := c.NewEvent()
+	ev.WriteKey = "wk"
+	ev.Dataset = "ds"
+	ev.AddField("widgets", 1)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if started, _ := out.counts(); started != 1 {
+		t.Errorf("got %d Start calls after first Send, want exactly 1", started)
+	}
+
+	c.Close()
+	if started, stopped := out.counts(); started != 1 || stopped != 1 {
+		t.Errorf("got started=%d stopped=%d after Close, want 1/1 (no double start)", started, stopped)
+	}
+}
+
+func TestClientCloseStartsAndStopsUnusedOutput(t *testing.T) {
+	c := newDefaultClient()
+	out := &recordingOutput{}
+	c.Output = out
+
+	c.Close()
+
+	if started, stopped := out.counts(); started != 1 || stopped != 1 {
+		t.Errorf("got started=%d stopped=%d closing a Client that never sent anything, want 1/1", started, stopped)
+	}
+}
+
+func TestInitClosesPreviousDefaultClient(t *testing.T) {
+	orig := defaultClient
+	defer func() { defaultClient = orig }()
+
+	firstOut := &recordingOutput{}
+	defaultClient = newDefaultClient()
+	defaultClient.Output = firstOut
+	// Force the first default Client's Output to actually start, the way a
+	// real call through the package-level functions would.
+	defaultClient.ensureStarted()
+
+	if err := Init(Config{WriteKey: "wk", Dataset: "ds", Output: &recordingOutput{}}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	if started, stopped := firstOut.counts(); started != 1 || stopped != 1 {
+		t.Errorf("got started=%d stopped=%d on the Client Init replaced, want 1/1 (it must be stopped, not leaked)", started, stopped)
+	}
+}
@@ -8,13 +8,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"reflect"
 	"strings"
 	"sync"
 	"time"
-
-	"gopkg.in/alexcesaro/statsd.v2"
 )
 
 const (
@@ -79,6 +77,28 @@ type Config struct {
 	MaxConcurrentBatches uint          // how many batches can be inflight simultaneously
 	PendingWorkCapacity  uint          // how many events to allow to pile up
 
+	// Output is what actually transmits Events, decoupling the rest of
+	// libhoney from HTTP. If unset, a batching HTTP transport talking to
+	// APIHost is used. See WriterOutput, MockOutput, and DiscardOutput for
+	// alternatives useful in debugging, dry runs, and tests.
+	Output Output
+
+	// Sampler decides whether (and at what effective rate) each Event sent
+	// through this Config's Client is kept. If unset, a deterministic
+	// sampler keeping 1-in-SampleRate events is used. See DynamicSampler
+	// and KeySampler for alternatives that vary the rate per event.
+	Sampler Sampler
+
+	// HTTPClient, if set, is used by the default Output implementation
+	// instead of a plain http.Client with default settings. Ignored if
+	// Output is set. Mutually exclusive with Transport.
+	HTTPClient *http.Client
+
+	// Transport, if set (and HTTPClient is not), is used as the
+	// http.RoundTripper for the default Output implementation's
+	// http.Client. Useful for instrumented transports, proxies, or
+	// record/replay in tests. Ignored if Output or HTTPClient is set.
+	Transport http.RoundTripper
 }
 
 type Event struct {
@@ -90,6 +110,11 @@ type Event struct {
 	SampleRate uint
 	// APIHost, if set, overrides whatever is found in Config
 	APIHost string
+	// Sampler, if set, overrides whatever is found in Config or the
+	// originating Builder, and decides whether this specific event is kept
+	// or dropped (and at what effective rate) instead of the deterministic
+	// 1-in-SampleRate default.
+	Sampler Sampler
 	// Timestamp, if set, specifies the time for this event. If unset, defaults
 	// to Now()
 	Timestamp time.Time
@@ -100,6 +125,11 @@ type Event struct {
 
 	// fieldHolder contains fields (and methods) common to both events and builders
 	fieldHolder
+
+	// client is the Client this Event was created from, and is used by Send
+	// to route the event to the right transmission queue and Responses
+	// channel. It is always set, via NewEvent/Builder.NewEvent.
+	client *Client
 }
 
 type Builder struct {
@@ -111,6 +141,9 @@ type Builder struct {
 	SampleRate uint
 	// APIHost, if set, overrides whatever is found in Config
 	APIHost string
+	// Sampler, if set, overrides whatever is found in Config and is
+	// inherited by every Event this Builder creates.
+	Sampler Sampler
 
 	// fieldHolder contains fields (and methods) common to both events and builders
 	fieldHolder
@@ -118,6 +151,10 @@ type Builder struct {
 	// any dynamic fields to apply to each generated event
 	dynFields     []dynamicField
 	dynFieldsLock sync.Mutex
+
+	// client is the Client this Builder (and any Events it creates) belongs
+	// to.
+	client *Client
 }
 
 type fieldHolder struct {
@@ -125,31 +162,22 @@ type fieldHolder struct {
 	lock sync.Mutex
 }
 
-// globals for singleton-like behavior
-var (
-	tx               txClient
-	responses        chan Response
-	blockOnResponses bool
-	sd               *statsd.Client
-	globalState      *Builder
-)
+// defaultClient backs the package-level functions (Init, NewEvent, SendNow,
+// etc.) so that using libhoney without ever constructing a Client -- or
+// without calling Init -- still works, using sensible defaults instead of
+// panicking.
+var defaultClient *Client
 
 type dynamicField struct {
 	name string
 	fn   func() interface{}
 }
 
-// initialize a default config to protect ourselves against using unitialized
-// values if someone forgets to run Init(). It's fine if things don't work
-// without running Init; it's not fine if they panic.
+// initialize a default client to protect ourselves against using
+// uninitialized values if someone forgets to run Init(). It's fine if things
+// don't work without running Init; it's not fine if they panic.
 func init() {
-	// initialize global statsd client as mute to provide a working default
-	sd, _ = statsd.New(statsd.Mute(true))
-	globalState = &Builder{
-		SampleRate: 1,
-		dynFields:  make([]dynamicField, 0, 0),
-	}
-	globalState.data = make(map[string]interface{})
+	defaultClient = newDefaultClient()
 }
 
 // Init must be called once on app initialization. All fields in the Config
@@ -158,68 +186,40 @@ func init() {
 // SampleRate, and APIHost can all be overridden on a per-builder or per-event
 // basis.
 //
+// Init replaces the package-level default Client with one built from config;
+// calling it is optional, but lets you configure the default Client instead
+// of accepting its bare defaults. Applications that want multiple
+// independently configured pipelines should use NewClient instead.
+//
 // Make sure to call Close() to flush transmisison buffers.
 func Init(config Config) error {
-	// Default sample rate should be 1. 0 is invalid.
-	if config.SampleRate == 0 {
-		config.SampleRate = defaultSampleRate
-	}
-	if config.APIHost == "" {
-		config.APIHost = defaultAPIHost
-	}
-
-	sd, _ = statsd.New(statsd.Prefix("libhoney"))
-
-	responses = make(chan Response, config.PendingWorkCapacity*2)
-
-	// spin up the global transmission
-	tx = &txDefaultClient{
-		maxBatchSize:         config.MaxBatchSize,
-		batchTimeout:         config.SendFrequency,
-		maxConcurrentBatches: config.MaxConcurrentBatches,
-		pendingWorkCapacity:  config.PendingWorkCapacity,
-		blockOnSend:          config.BlockOnSend,
-	}
-
-	if err := tx.Start(); err != nil {
+	c, err := NewClient(config)
+	if err != nil {
 		return err
 	}
-
-	globalState = &Builder{
-		WriteKey:   config.WriteKey,
-		Dataset:    config.Dataset,
-		SampleRate: config.SampleRate,
-		APIHost:    config.APIHost,
-		dynFields:  make([]dynamicField, 0, 0),
+	old := defaultClient
+	defaultClient = c
+	if old != nil {
+		old.Close()
 	}
-	globalState.data = make(map[string]interface{})
-
 	return nil
 }
 
 // Close waits for all in-flight messages to be sent. You should
 // call Close() before app termination.
 func Close() {
-	tx.Stop()
-	close(responses)
+	defaultClient.Close()
 }
 
 // SendNow is a shortcut to create an event, add data, and send the event.
 func SendNow(data interface{}) error {
-	ev := NewEvent()
-	if err := ev.Add(data); err != nil {
-		return err
-	}
-	if err := ev.Send(); err != nil {
-		return err
-	}
-	return nil
+	return defaultClient.SendNow(data)
 }
 
 // Responses returns the channel from which the caller can read the responses
 // to sent events
 func Responses() chan Response {
-	return responses
+	return defaultClient.Responses()
 }
 
 // AddDynamicField takes a field name and a function that will generate values
@@ -227,26 +227,26 @@ func Responses() chan Response {
 // created and added as a field (with name as the key) to the newly created
 // event.
 func AddDynamicField(name string, fn func() interface{}) error {
-	return globalState.AddDynamicField(name, fn)
+	return defaultClient.AddDynamicField(name, fn)
 }
 
 // AddField adds a Field to the global scope. This metric will be inherited by
 // all builders and events.
 func AddField(name string, val interface{}) {
-	globalState.AddField(name, val)
+	defaultClient.AddField(name, val)
 }
 
 // Add adds its data to the global scope. It adds all fields in a struct or all
 // keys in a map as individual Fields. These metrics will be inherited by all
 // builders and events.
 func Add(data interface{}) error {
-	return globalState.Add(data)
+	return defaultClient.Add(data)
 }
 
 // Creates a new event prepopulated with any Fields present in the global
 // scope.
 func NewEvent() *Event {
-	return globalState.NewEvent()
+	return defaultClient.NewEvent()
 }
 
 // AddField adds an individual metric to the event or builder on which it is
@@ -256,7 +256,19 @@ func (f *fieldHolder) AddField(key string, val interface{}) {
 	defer f.lock.Unlock()
 	// run a sanity check on data, transparently drop if it fails.
 	if validateData(val) {
-		f.data[key] = val
+		f.data[key] = autoTypedValue(val)
+	}
+}
+
+// AddTypedField works like AddField, but additionally attaches a
+// Representation hint describing val's unit or shape (e.g. RepBytes,
+// RepPercent), which Honeycomb can use to pick sensible axes and formatting
+// without the field's name having to encode units itself.
+func (f *fieldHolder) AddTypedField(key string, val interface{}, rep Representation) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if validateData(val) {
+		f.data[key] = typedValue{value: normalizeForWire(val), rep: rep}
 	}
 }
 
@@ -340,8 +352,14 @@ func (f *fieldHolder) addStruct(s interface{}) error {
 			fName = fieldInfo.Name
 		}
 
-		if validateValue(sVal.Field(i)) {
-			f.data[fName] = sVal.Field(i).Interface()
+		if !validateValue(sVal.Field(i)) {
+			continue
+		}
+		raw := sVal.Field(i).Interface()
+		if rep, ok := representationFromTag(fieldInfo.Tag.Get("honeycomb")); ok {
+			f.data[fName] = typedValue{value: normalizeForWire(raw), rep: rep}
+		} else {
+			f.data[fName] = autoTypedValue(raw)
 		}
 	}
 	return nil
@@ -368,7 +386,7 @@ func (f *fieldHolder) addMap(m interface{}) error {
 			return fmt.Errorf("failed to add map: key type %s unaccepted", key.Type().Kind())
 		}
 		if validateValue(mVal.MapIndex(key)) {
-			f.data[keyStr] = mVal.MapIndex(key).Interface()
+			f.data[keyStr] = autoTypedValue(mVal.MapIndex(key).Interface())
 		}
 	}
 	return nil
@@ -391,20 +409,29 @@ func (f *fieldHolder) AddFunc(fn func() (string, interface{}, error)) error {
 
 // Send dispatches the event to be sent to Honeycomb.
 //
-// If you have sampling enabled
-// (i.e. SampleRate >1), Send will only actually transmit data with a
-// probability of 1/SampleRate. No error is returned whether or not traffic
-// is sampled, however, the Response sent down the response channel will
-// indicate the event was sampled in the errors Err field.
+// Send runs the event through its Sampler (e.Sampler, or the one inherited
+// from the Builder/Client that created it, defaulting to a deterministic
+// 1-in-SampleRate sampler). No error is returned whether or not traffic is
+// sampled, however, the Response sent down the response channel will
+// indicate the event was sampled in the errors Err field. The sample rate
+// the Sampler actually applied is recorded back onto e.SampleRate before
+// transmission, so Honeycomb's server-side aggregates can scale back up
+// correctly even when different events used different rates.
 //
 // Send inherits the values of required fields from Config. If any required
 // fields are specified in neither Config nor the Event, Send will return an
 // error.  Required fields are APIHost, WriteKey, and Dataset. Values specified
 // in an Event override Config.
 func (e *Event) Send() error {
-	if shouldDrop(e.SampleRate) {
-		sd.Increment("sampled")
-		sendDroppedResponse(e, "event dropped due to sampling")
+	sampler := e.Sampler
+	if sampler == nil {
+		sampler = deterministicSampler{}
+	}
+	keep, effectiveRate := sampler.Sample(e)
+	e.SampleRate = effectiveRate
+	if !keep {
+		e.client.sd.Increment("sampled")
+		e.client.sendDroppedResponse(e, "event dropped due to sampling")
 		return nil
 	}
 	if len(e.data) == 0 {
@@ -420,31 +447,36 @@ func (e *Event) Send() error {
 		return errors.New("No Dataset for Honeycomb. Can't send datasetless.")
 	}
 
-	tx.Add(e)
+	if err := e.client.ensureStarted(); err != nil {
+		return err
+	}
+	e.client.Output.Add(e)
 	return nil
 }
 
-// sendResponse sends a dropped event response down the response channel
-func sendDroppedResponse(e *Event, message string) {
-	r := Response{
+// sendDroppedResponse sends a dropped event response down the client's
+// response channel
+func (c *Client) sendDroppedResponse(e *Event, message string) {
+	c.sendResponse(Response{
 		Err:      errors.New(message),
 		Metadata: e.Metadata,
-	}
-	if blockOnResponses {
-		responses <- r
+	})
+}
+
+// sendResponse delivers r on the client's Responses channel, blocking if
+// Config.BlockOnResponse is set and dropping it otherwise if nothing is
+// reading from the channel.
+func (c *Client) sendResponse(r Response) {
+	if c.config.BlockOnResponse {
+		c.responses <- r
 	} else {
 		select {
-		case responses <- r:
+		case c.responses <- r:
 		default:
 		}
 	}
 }
 
-// returns true if the sample should be dropped
-func shouldDrop(rate uint) bool {
-	return rand.Intn(int(rate)) != 0
-}
-
 // returns true if the first character of the string is lowercase
 func isFirstLower(s string) bool {
 	return false
@@ -453,7 +485,7 @@ func isFirstLower(s string) bool {
 // NewBuilder creates a new event builder. The builder inherits any
 // Dynamic or Static Fields present in the global scope.
 func NewBuilder() *Builder {
-	return globalState.Clone()
+	return defaultClient.NewBuilder()
 }
 
 // AddDynamicField adds a dynamic field to the builder. Any events
@@ -490,7 +522,9 @@ func (b *Builder) NewEvent() *Event {
 		Dataset:    b.Dataset,
 		SampleRate: b.SampleRate,
 		APIHost:    b.APIHost,
+		Sampler:    b.Sampler,
 		Timestamp:  time.Now(),
+		client:     b.client,
 	}
 	e.data = make(map[string]interface{})
 
@@ -513,7 +547,9 @@ func (b *Builder) Clone() *Builder {
 		Dataset:    b.Dataset,
 		SampleRate: b.SampleRate,
 		APIHost:    b.APIHost,
+		Sampler:    b.Sampler,
 		dynFields:  make([]dynamicField, 0, len(b.dynFields)),
+		client:     b.client,
 	}
 	newB.data = make(map[string]interface{})
 	// copy static metrics (everything's been serialized so flat copy is OK)
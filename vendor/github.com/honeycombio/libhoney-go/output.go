@@ -0,0 +1,126 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterOutput is an Output that serializes each Event as a JSON line and
+// writes it to W. It's useful for debugging, dry runs, or redirecting
+// events to a local collector process instead of Honeycomb's API.
+type WriterOutput struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// Add writes ev to W as a single line of JSON.
+func (w *WriterOutput) Add(ev *Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// best-effort: WriterOutput has no Responses channel to report errors
+	// on, so a write or encoding failure is simply dropped.
+	json.NewEncoder(w.W).Encode(newEventOnWire(ev))
+}
+
+func (w *WriterOutput) Start() error {
+	return nil
+}
+
+func (w *WriterOutput) Stop() error {
+	return nil
+}
+
+// MockOutput is an Output that records every Event passed to Add instead of
+// transmitting it anywhere, so that tests can assert on exactly what would
+// have been sent to Honeycomb without making any network calls.
+type MockOutput struct {
+	mu     sync.Mutex
+	events []*Event
+	added  chan struct{}
+}
+
+// Add records ev.
+func (m *MockOutput) Add(ev *Event) {
+	m.mu.Lock()
+	m.events = append(m.events, ev)
+	ch := m.added
+	m.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (m *MockOutput) Start() error {
+	return nil
+}
+
+func (m *MockOutput) Stop() error {
+	return nil
+}
+
+// Events returns a snapshot of every Event recorded so far.
+func (m *MockOutput) Events() []*Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Event, len(m.events))
+	copy(out, m.events)
+	return out
+}
+
+// Reset discards every Event recorded so far.
+func (m *MockOutput) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = nil
+}
+
+// WaitForEvent blocks until at least one Event has been recorded or timeout
+// elapses, whichever comes first, then returns a snapshot of everything
+// recorded and whether the wait found something before timing out. It lets
+// tests assert on asynchronously sent events without sleeping arbitrary
+// amounts of time.
+func (m *MockOutput) WaitForEvent(timeout time.Duration) ([]*Event, bool) {
+	m.mu.Lock()
+	if len(m.events) > 0 {
+		m.mu.Unlock()
+		return m.Events(), true
+	}
+	if m.added == nil {
+		m.added = make(chan struct{}, 1)
+	}
+	ch := m.added
+	m.mu.Unlock()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-ch:
+			// the signal may be left over from an Add before a Reset
+			if events := m.Events(); len(events) > 0 {
+				return events, true
+			}
+		case <-deadline:
+			return m.Events(), false
+		}
+	}
+}
+
+// DiscardOutput is an Output that drops every Event without recording or
+// sending it anywhere. It's useful for disabling libhoney entirely -- e.g.
+// in tests that don't care about telemetry -- without littering call sites
+// with conditionals.
+type DiscardOutput struct{}
+
+func (DiscardOutput) Add(ev *Event) {}
+func (DiscardOutput) Start() error  { return nil }
+func (DiscardOutput) Stop() error   { return nil }
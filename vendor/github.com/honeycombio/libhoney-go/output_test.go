@@ -0,0 +1,81 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriterOutput(t *testing.T) {
+	var buf bytes.Buffer
+	w := &WriterOutput{W: &buf}
+
+	c, err := NewClient(Config{
+		WriteKey: "wk",
+		Dataset:  "ds",
+		Output:   w,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	ev := c.NewEvent()
+	ev.AddField("widgets", 7)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var wire eventOnWire
+	if err := json.Unmarshal(buf.Bytes(), &wire); err != nil {
+		t.Fatalf("unmarshalling written event: %v", err)
+	}
+	if got := wire.Data["widgets"]; got != float64(7) {
+		t.Errorf("got widgets=%v, want 7", got)
+	}
+}
+
+func TestMockOutput(t *testing.T) {
+	m := &MockOutput{}
+
+	c, err := NewClient(Config{
+		WriteKey: "wk",
+		Dataset:  "ds",
+		Output:   m,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	if len(m.Events()) != 0 {
+		t.Fatalf("expected no events recorded yet")
+	}
+
+	ev := c.NewEvent()
+	ev.AddField("widgets", 7)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	events, ok := m.WaitForEvent(time.Second)
+	if !ok {
+		t.Fatalf("timed out waiting for event")
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if got := events[0].data["widgets"]; got != 7 {
+		t.Errorf("got widgets=%v, want 7", got)
+	}
+
+	m.Reset()
+	if len(m.Events()) != 0 {
+		t.Errorf("expected Reset to clear recorded events")
+	}
+}
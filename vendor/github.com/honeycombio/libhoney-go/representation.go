@@ -0,0 +1,89 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Representation is a hint describing the unit or shape of a field's value,
+// so that Honeycomb's server-side visualizations can pick sensible axes and
+// formatting without the field's name having to encode that information
+// itself (e.g. "latency_ms", "size_bytes"). Attach one with AddTypedField,
+// or via a `honeycomb:"..."` struct tag when using Add.
+type Representation string
+
+const (
+	RepDuration  Representation = "duration_ms"
+	RepBytes     Representation = "bytes"
+	RepTimestamp Representation = "timestamp"
+	RepCount     Representation = "count"
+	RepPercent   Representation = "percent"
+	RepEnum      Representation = "enum"
+)
+
+// typedValue pairs a field's value with the Representation hint attached to
+// it, if any. It's what actually gets stored in fieldHolder.data for fields
+// added via AddTypedField, or inferred via a honeycomb struct tag or the
+// time.Duration fast path.
+type typedValue struct {
+	value interface{}
+	rep   Representation
+}
+
+// MarshalJSON collapses a typedValue with no Representation down to a flat
+// value, preserving the pre-existing wire shape for fields that don't use
+// this feature; otherwise it emits {"value":..., "rep":"..."}.
+func (t typedValue) MarshalJSON() ([]byte, error) {
+	if t.rep == "" {
+		return json.Marshal(t.value)
+	}
+	return json.Marshal(struct {
+		Value interface{}    `json:"value"`
+		Rep   Representation `json:"rep"`
+	}{t.value, t.rep})
+}
+
+// autoTypedValue applies automatic Representation hints for types libhoney
+// recognizes on sight. Currently that's just time.Duration -- the single
+// most common field type sent to Honeycomb -- which is converted to
+// milliseconds and tagged RepDuration. Any other value passes through
+// unchanged.
+func autoTypedValue(val interface{}) interface{} {
+	if _, ok := val.(time.Duration); ok {
+		return typedValue{value: normalizeForWire(val), rep: RepDuration}
+	}
+	return val
+}
+
+// normalizeForWire converts val to the form it should actually be sent in,
+// regardless of whether its Representation was inferred (autoTypedValue) or
+// requested explicitly (AddTypedField, a honeycomb struct tag): a
+// time.Duration is always converted to milliseconds, since nanoseconds are
+// never what RepDuration (or any other rep) means for a duration value. Any
+// other value passes through unchanged.
+func normalizeForWire(val interface{}) interface{} {
+	if d, ok := val.(time.Duration); ok {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return val
+}
+
+// representationFromTag parses a `honeycomb:"..."` struct tag value into a
+// Representation. Two forms are supported: an explicit "rep=<value>" (e.g.
+// `honeycomb:"rep=duration_ms"`), and a bare shorthand matching one of the
+// Rep* constants' own string value (e.g. `honeycomb:"bytes"`). Returns
+// ok=false if tag is empty, meaning no hint was requested.
+func representationFromTag(tag string) (rep Representation, ok bool) {
+	if tag == "" {
+		return "", false
+	}
+	if strings.HasPrefix(tag, "rep=") {
+		return Representation(strings.TrimPrefix(tag, "rep=")), true
+	}
+	return Representation(tag), true
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAddTypedFieldEmitsValueAndRep(t *testing.T) {
+	ev := NewEvent()
+	ev.AddTypedField("response_size", 4096, RepBytes)
+
+	encoded, err := json.Marshal(ev.data["response_size"])
+	if err != nil {
+		t.Fatalf("marshalling typed field: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling typed field: %v", err)
+	}
+	if decoded["value"] != float64(4096) {
+		t.Errorf("got value=%v, want 4096", decoded["value"])
+	}
+	if decoded["rep"] != string(RepBytes) {
+		t.Errorf("got rep=%v, want %q", decoded["rep"], RepBytes)
+	}
+}
+
+func TestAddTypedFieldConvertsExplicitDuration(t *testing.T) {
+	ev := NewEvent()
+	ev.AddTypedField("elapsed", 250*time.Millisecond, RepDuration)
+
+	encoded, err := json.Marshal(ev.data["elapsed"])
+	if err != nil {
+		t.Fatalf("marshalling typed field: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling typed field: %v", err)
+	}
+	if decoded["value"] != float64(250) {
+		t.Errorf("got value=%v, want 250 (ms), not raw nanoseconds", decoded["value"])
+	}
+}
+
+func TestAddFieldPlainValueHasNoRepWrapper(t *testing.T) {
+	ev := NewEvent()
+	ev.AddField("widgets", 7)
+
+	encoded, err := json.Marshal(ev.data["widgets"])
+	if err != nil {
+		t.Fatalf("marshalling field: %v", err)
+	}
+	if string(encoded) != "7" {
+		t.Errorf("got %s, want a flat 7 with no rep wrapper", encoded)
+	}
+}
+
+func TestAddFieldDurationFastPath(t *testing.T) {
+	ev := NewEvent()
+	ev.AddField("latency", 250*time.Millisecond)
+
+	encoded, err := json.Marshal(ev.data["latency"])
+	if err != nil {
+		t.Fatalf("marshalling field: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling field: %v", err)
+	}
+	if decoded["value"] != float64(250) {
+		t.Errorf("got value=%v, want 250", decoded["value"])
+	}
+	if decoded["rep"] != string(RepDuration) {
+		t.Errorf("got rep=%v, want %q", decoded["rep"], RepDuration)
+	}
+}
+
+func TestAddStructHoneycombTag(t *testing.T) {
+	type payload struct {
+		SizeBytes int `json:"size" honeycomb:"bytes"`
+		Widgets   int `json:"widgets"`
+	}
+
+	ev := NewEvent()
+	if err := ev.Add(payload{SizeBytes: 12, Widgets: 3}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	encoded, err := json.Marshal(ev.data["size"])
+	if err != nil {
+		t.Fatalf("marshalling tagged field: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling tagged field: %v", err)
+	}
+	if decoded["value"] != float64(12) {
+		t.Errorf("got value=%v, want 12", decoded["value"])
+	}
+	if decoded["rep"] != string(RepBytes) {
+		t.Errorf("got rep=%v, want %q", decoded["rep"], RepBytes)
+	}
+
+	untagged, err := json.Marshal(ev.data["widgets"])
+	if err != nil {
+		t.Fatalf("marshalling untagged field: %v", err)
+	}
+	if string(untagged) != "3" {
+		t.Errorf("got %s for untagged field, want a flat 3", untagged)
+	}
+}
+
+func TestAddStructHoneycombTagConvertsDuration(t *testing.T) {
+	type payload struct {
+		Elapsed time.Duration `json:"elapsed" honeycomb:"rep=duration_ms"`
+	}
+
+	ev := NewEvent()
+	if err := ev.Add(payload{Elapsed: 250 * time.Millisecond}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	encoded, err := json.Marshal(ev.data["elapsed"])
+	if err != nil {
+		t.Fatalf("marshalling tagged duration field: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling tagged duration field: %v", err)
+	}
+	if decoded["value"] != float64(250) {
+		t.Errorf("got value=%v, want 250 (ms), not raw nanoseconds", decoded["value"])
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import "time"
+
+// Response is handed back on the Responses channel for each event sent. It
+// lets the caller find out whether an event was successfully transmitted,
+// sampled away, or failed, without blocking Send().
+type Response struct {
+	// Metadata is whatever value was added via Event.Metadata, handed back
+	// to the caller unchanged. It is never sent to Honeycomb.
+	Metadata interface{}
+
+	// StatusCode is the status Honeycomb reported for this particular event
+	// in the per-event status array returned for its batch. It is zero if
+	// no per-event status was received (e.g. the event was sampled away,
+	// the request itself failed, or the whole batch got an HTTP error).
+	StatusCode int
+
+	// Body is the response body received from the Honeycomb API, if any.
+	// The default batching Output does not set it; it leaves Body nil.
+	Body []byte
+
+	// Duration is how long it took to send this event's batch.
+	Duration time.Duration
+
+	// Err is non-nil if the event was not successfully sent -- due to
+	// sampling, a transport error, or an HTTP error response.
+	Err error
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// Sampler decides whether a given Event should be kept, and at what
+// effective sample rate. The effective rate is recorded onto the Event
+// before it's sent (or before the drop is reported on the Responses
+// channel), so Honeycomb's server-side aggregates can scale counts back up
+// correctly even when different events were sampled at different rates.
+type Sampler interface {
+	Sample(ev *Event) (keep bool, effectiveRate uint)
+}
+
+// deterministicSampler is libhoney's original sampling strategy: keep
+// 1-in-rate events, chosen at random, using the rate found on the event
+// itself (which NewEvent populates from the Builder/Config if not set
+// directly).
+type deterministicSampler struct{}
+
+func (deterministicSampler) Sample(ev *Event) (bool, uint) {
+	rate := ev.SampleRate
+	if rate == 0 {
+		rate = defaultSampleRate
+	}
+	return !shouldDrop(rate), rate
+}
+
+// returns true if the sample should be dropped
+func shouldDrop(rate uint) bool {
+	return rand.Intn(int(rate)) != 0
+}
+
+// DynamicSampler samples each Event using a rate read from one of the
+// event's own fields, rather than a single rate shared by every event. This
+// lets a high-volume call site self-tune how aggressively it's sampled by
+// setting FieldName (e.g. "sample_rate") to a different value per event --
+// useful when, say, error events should always be kept but routine success
+// events should be sampled heavily.
+type DynamicSampler struct {
+	// FieldName is the Event field holding the desired sample rate for that
+	// specific event.
+	FieldName string
+
+	// DefaultRate is used when FieldName is absent from the event, or
+	// isn't a usable positive integer.
+	DefaultRate uint
+}
+
+// Sample implements Sampler.
+func (s *DynamicSampler) Sample(ev *Event) (bool, uint) {
+	rate := s.DefaultRate
+	if rate == 0 {
+		rate = defaultSampleRate
+	}
+	if raw, ok := ev.data[s.FieldName]; ok {
+		if r, ok := toPositiveUint(raw); ok {
+			rate = r
+		}
+	}
+	return !shouldDrop(rate), rate
+}
+
+// KeySampler samples events based on a hash of a configurable set of
+// fields (its "key"), keeping a running per-key count and only passing
+// through the first occurrence of a given key and every GoalSampleRate-th
+// occurrence after it (1st, 1+GoalSampleRate-th, ...). This throttles
+// bursty, high-volume keys (e.g. a common http.status/endpoint pairing)
+// while still letting rare keys through untouched.
+type KeySampler struct {
+	// Fields lists the Event fields whose values are combined, in order, to
+	// form each event's sampling key, e.g. []string{"http.status", "endpoint"}.
+	Fields []string
+
+	// GoalSampleRate is the rate applied to events sharing a key: 1 in
+	// every GoalSampleRate occurrences of that key is kept.
+	GoalSampleRate uint
+
+	mu     sync.Mutex
+	counts map[string]uint
+}
+
+// Sample implements Sampler.
+func (s *KeySampler) Sample(ev *Event) (bool, uint) {
+	rate := s.GoalSampleRate
+	if rate == 0 {
+		rate = defaultSampleRate
+	}
+
+	key := s.key(ev)
+
+	s.mu.Lock()
+	if s.counts == nil {
+		s.counts = make(map[string]uint)
+	}
+	s.counts[key]++
+	count := s.counts[key]
+	s.mu.Unlock()
+
+	return (count-1)%rate == 0, rate
+}
+
+// key hashes the configured Fields' values together into a single string
+// suitable for use as a map key.
+func (s *KeySampler) key(ev *Event) string {
+	parts := make([]string, len(s.Fields))
+	for i, field := range s.Fields {
+		parts[i] = fmt.Sprintf("%v", ev.data[field])
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return string(sum[:])
+}
+
+// toPositiveUint converts v to a uint if it's a positive integer or float
+// value, as might come back from decoding a field a caller set with
+// AddField.
+func toPositiveUint(v interface{}) (uint, bool) {
+	switch n := v.(type) {
+	case uint:
+		return n, n > 0
+	case int:
+		return uint(n), n > 0
+	case int64:
+		return uint(n), n > 0
+	case float64:
+		return uint(n), n >= 1
+	}
+	return 0, false
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDynamicSamplerPropagatesEffectiveRate(t *testing.T) {
+	var buf bytes.Buffer
+
+	c, err := NewClient(Config{
+		WriteKey: "wk",
+		Dataset:  "ds",
+		Output:   &WriterOutput{W: &buf},
+		Sampler: &DynamicSampler{
+			FieldName:   "sample_rate",
+			DefaultRate: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	ev := c.NewEvent()
+	ev.AddField("sample_rate", 10)
+	ev.SampleRate = 10 // not read by DynamicSampler, which uses the sample_rate field
+
+	// Run Sample directly to avoid relying on the random keep/drop outcome
+	// for this assertion -- we only care that the effective rate used is
+	// the one read from the field, and that it round-trips through the
+	// wire payload.
+	keep, rate := ev.Sampler.Sample(ev)
+	_ = keep
+	if rate != 10 {
+		t.Fatalf("got effective rate %d, want 10", rate)
+	}
+
+	ev.SampleRate = rate
+	wire := newEventOnWire(ev)
+	encoded, err := json.Marshal(wire)
+	if err != nil {
+		t.Fatalf("marshalling wire event: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshalling wire event: %v", err)
+	}
+	if got := decoded["samplerate"]; got != float64(10) {
+		t.Errorf("got samplerate=%v in JSON payload, want 10", got)
+	}
+}
+
+func TestKeySamplerKeepsOnePerGoalRate(t *testing.T) {
+	s := &KeySampler{
+		Fields:         []string{"endpoint"},
+		GoalSampleRate: 3,
+	}
+
+	c, err := NewClient(Config{
+		WriteKey: "wk",
+		Dataset:  "ds",
+		Output:   &DiscardOutput{},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	kept := 0
+	for i := 0; i < 9; i++ {
+		ev := c.NewEvent()
+		ev.AddField("endpoint", "/widgets")
+		keep, rate := s.Sample(ev)
+		if rate != 3 {
+			t.Fatalf("got rate %d, want 3", rate)
+		}
+		if keep {
+			kept++
+		}
+	}
+	if kept != 3 {
+		t.Errorf("got %d kept out of 9 at goal rate 3, want 3", kept)
+	}
+}
+
+func TestKeySamplerDefaultRateKeepsEverything(t *testing.T) {
+	s := &KeySampler{Fields: []string{"endpoint"}}
+
+	c, err := NewClient(Config{
+		WriteKey: "wk",
+		Dataset:  "ds",
+		Output:   &DiscardOutput{},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		ev := c.NewEvent()
+		ev.AddField("endpoint", "/widgets")
+		keep, rate := s.Sample(ev)
+		if rate != 1 {
+			t.Fatalf("got rate %d, want 1", rate)
+		}
+		if !keep {
+			t.Errorf("event %d: got dropped at default GoalSampleRate, want every event kept", i)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBatchSize         = 50
+	defaultBatchTimeout         = 100 * time.Millisecond
+	defaultMaxConcurrentBatches = 10
+	defaultPendingWorkCapacity  = 1000
+
+	maxBatchRetries = 5
+	retryBackoff    = 100 * time.Millisecond
+)
+
+// Output is libhoney's transport abstraction: anything that can accept
+// Events and be started and stopped can serve as a Client's Output. This is
+// what actually gets Events off to Honeycomb -- or, via the implementations
+// in output.go, to a writer for debugging, or nowhere at all in tests.
+type Output interface {
+	// Add accepts an event for transmission. Depending on the
+	// implementation and its configuration, this may block or drop the
+	// event if its internal queue is full.
+	Add(ev *Event)
+	// Start prepares the Output to begin accepting events, e.g. by spinning
+	// up background workers.
+	Start() error
+	// Stop waits for any in-flight events to be sent, then shuts down.
+	Stop() error
+}
+
+// txDefaultClient is the Output used when none is otherwise specified. It
+// groups events by (APIHost, WriteKey, Dataset) into batches -- flushed
+// whenever a batch reaches maxBatchSize or batchTimeout elapses -- and POSTs
+// each batch to /1/batch/<dataset>, fanning the sends themselves out across
+// up to maxConcurrentBatches goroutines.
+type txDefaultClient struct {
+	maxBatchSize         uint
+	batchTimeout         time.Duration
+	maxConcurrentBatches uint
+	pendingWorkCapacity  uint
+	blockOnSend          bool
+
+	// httpClient, if set, is used instead of a plain http.Client with
+	// default settings. Takes precedence over transport.
+	httpClient *http.Client
+	// transport, if set (and httpClient is not), is used as the
+	// http.RoundTripper for this client's http.Client.
+	transport http.RoundTripper
+
+	// client is the Client this transport belongs to; it's used to reach
+	// the Client's statsd counters and Responses channel.
+	client *Client
+
+	events   chan *Event
+	sem      chan struct{} // bounds the number of concurrently in-flight batch sends
+	batchWG  sync.WaitGroup
+	loopDone chan struct{}
+}
+
+// batchKey groups events that can be sent together in a single batch
+// request: the destination, credentials, and dataset must all match.
+type batchKey struct {
+	apiHost  string
+	writeKey string
+	dataset  string
+}
+
+func keyFor(ev *Event) batchKey {
+	return batchKey{apiHost: ev.APIHost, writeKey: ev.WriteKey, dataset: ev.Dataset}
+}
+
+func (t *txDefaultClient) Start() error {
+	t.events = make(chan *Event, t.pendingWorkCapacity)
+	t.sem = make(chan struct{}, t.maxConcurrentBatches)
+	t.loopDone = make(chan struct{})
+
+	go t.batchLoop()
+	return nil
+}
+
+// Add queues ev for transmission. If blockOnSend is false and the queue is
+// full, ev is dropped and a Response noting the overflow is sent instead
+// (see Client.sendResponse for the blocking/non-blocking rules that governs
+// delivery of that Response in turn).
+func (t *txDefaultClient) Add(ev *Event) {
+	if t.blockOnSend {
+		t.events <- ev
+		return
+	}
+	select {
+	case t.events <- ev:
+	default:
+		t.client.sd.Increment("queue_overflow")
+		t.client.sendDroppedResponse(ev, "queue overflow: event dropped")
+	}
+}
+
+// Stop closes the input queue and waits for every pending and in-flight
+// batch to finish sending before returning.
+func (t *txDefaultClient) Stop() error {
+	close(t.events)
+	<-t.loopDone
+	return nil
+}
+
+// batchLoop collects incoming events into per-key batches, flushing a key's
+// batch as soon as it reaches maxBatchSize and flushing every pending batch
+// every batchTimeout. It exits once the events channel is closed and every
+// outstanding batch has finished sending.
+func (t *txDefaultClient) batchLoop() {
+	defer close(t.loopDone)
+
+	batches := make(map[batchKey][]*Event)
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+
+	flush := func(key batchKey) {
+		batch := batches[key]
+		if len(batch) == 0 {
+			return
+		}
+		delete(batches, key)
+		t.sendBatchAsync(key, batch)
+	}
+	flushAll := func() {
+		for key := range batches {
+			flush(key)
+		}
+	}
+
+	for {
+		select {
+		case ev, ok := <-t.events:
+			if !ok {
+				flushAll()
+				t.batchWG.Wait()
+				return
+			}
+			key := keyFor(ev)
+			batches[key] = append(batches[key], ev)
+			if uint(len(batches[key])) >= t.maxBatchSize {
+				flush(key)
+			}
+		case <-ticker.C:
+			flushAll()
+		}
+	}
+}
+
+// sendBatchAsync sends batch in its own goroutine, bounded to
+// maxConcurrentBatches concurrent sends via t.sem.
+func (t *txDefaultClient) sendBatchAsync(key batchKey, batch []*Event) {
+	t.batchWG.Add(1)
+	go func() {
+		defer t.batchWG.Done()
+		t.sem <- struct{}{}
+		defer func() { <-t.sem }()
+		t.sendBatch(key, batch)
+	}()
+}
+
+// sendBatch POSTs batch to Honeycomb and fans the per-event results back out
+// onto the Client's Responses channel.
+func (t *txDefaultClient) sendBatch(key batchKey, batch []*Event) {
+	wireEvents := make([]eventOnWire, len(batch))
+	for i, ev := range batch {
+		wireEvents[i] = newEventOnWire(ev)
+	}
+
+	body, err := json.Marshal(wireEvents)
+	if err != nil {
+		t.failBatch(batch, err)
+		return
+	}
+
+	batchURL := strings.TrimRight(key.apiHost, "/") + "/1/batch/" + url.PathEscape(key.dataset)
+
+	start := time.Now()
+	statuses, err := t.postBatchWithRetry(batchURL, key.writeKey, body)
+	duration := time.Since(start)
+
+	if err != nil {
+		t.client.sd.Increment("send_errors")
+		t.failBatch(batch, err)
+		return
+	}
+
+	t.client.sd.Increment("batches_sent")
+	t.client.sd.Count("events_sent", len(batch))
+
+	for i, ev := range batch {
+		resp := Response{Metadata: ev.Metadata, Duration: duration}
+		switch {
+		case i >= len(statuses):
+			resp.Err = errors.New("Honeycomb did not return a status for this event")
+		case statuses[i].Status >= 300:
+			resp.StatusCode = statuses[i].Status
+			resp.Err = fmt.Errorf("event was rejected by Honeycomb: %s", statuses[i].Error)
+		default:
+			resp.StatusCode = statuses[i].Status
+		}
+		t.client.sendResponse(resp)
+	}
+}
+
+// failBatch reports err as the Response for every event in batch, e.g.
+// because the batch could not be marshaled or sending it failed even after
+// retries.
+func (t *txDefaultClient) failBatch(batch []*Event, err error) {
+	for _, ev := range batch {
+		t.client.sendResponse(Response{Metadata: ev.Metadata, Err: err})
+	}
+}
+
+// batchResponse is one element of the JSON array Honeycomb's batch endpoint
+// returns, reporting the outcome for the event at the same index in the
+// request.
+type batchResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// postBatchWithRetry POSTs body to url, retrying with exponential backoff on
+// 5xx and 429 responses (honoring a Retry-After header if present) up to
+// maxBatchRetries times.
+func (t *txDefaultClient) postBatchWithRetry(url, writeKey string, body []byte) ([]batchResponse, error) {
+	backoff := retryBackoff
+
+	var lastErr error
+	for attempt := 0; attempt <= maxBatchRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		statuses, retryAfter, retryable, err := t.postBatch(url, writeKey, body)
+		if err == nil {
+			return statuses, nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+		if retryAfter > 0 {
+			backoff = retryAfter
+		}
+	}
+	return nil, lastErr
+}
+
+// postBatch issues a single POST of body to url. It returns the parsed
+// per-event statuses on success. On failure it reports whether the failure
+// is retryable (5xx or 429) alongside the Retry-After wait the server asked
+// for, if any; a non-retryable failure (e.g. a 4xx rejecting the request
+// itself, such as a bad write key) always has wait == 0.
+func (t *txDefaultClient) postBatch(url, writeKey string, body []byte) (statuses []batchResponse, wait time.Duration, retryable bool, err error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Honeycomb-Team", writeKey)
+
+	resp, err := t.httpClientOrDefault().Do(req)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		wait := retryAfter(resp.Header.Get("Retry-After"))
+		return nil, wait, true, fmt.Errorf("received status %d from Honeycomb API: %s", resp.StatusCode, respBody)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, 0, false, fmt.Errorf("received status %d from Honeycomb API: %s", resp.StatusCode, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, &statuses); err != nil {
+		return nil, 0, false, err
+	}
+	return statuses, 0, false, nil
+}
+
+// retryAfter parses an HTTP Retry-After header (in seconds; libhoney never
+// sees the HTTP-date form in practice) into a Duration, returning 0 if it's
+// absent or unparseable.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	secs, err := strconv.Atoi(header)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// httpClientOrDefault returns the http.Client this transport should use to
+// send batches, honoring httpClient/transport overrides from Config.
+func (t *txDefaultClient) httpClientOrDefault() *http.Client {
+	if t.httpClient != nil {
+		return t.httpClient
+	}
+	if t.transport != nil {
+		return &http.Client{Transport: t.transport}
+	}
+	return http.DefaultClient
+}
+
+// userAgent builds the User-Agent header sent with every batch request,
+// honoring UserAgentAddition if set.
+func userAgent() string {
+	ua := fmt.Sprintf("libhoney-go/%s", version)
+	if UserAgentAddition != "" {
+		ua = ua + " " + UserAgentAddition
+	}
+	return ua
+}
+
+// eventOnWire is the per-event payload shape expected by the
+// /1/batch/<dataset> endpoint, and the shape WriterOutput emits for each
+// event it sees.
+type eventOnWire struct {
+	Timestamp  time.Time              `json:"time"`
+	SampleRate uint                   `json:"samplerate"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+func newEventOnWire(ev *Event) eventOnWire {
+	return eventOnWire{
+		Timestamp:  ev.Timestamp,
+		SampleRate: ev.SampleRate,
+		Data:       ev.data,
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Honeycomb, Hound Technology, Inc. All rights reserved.
+// Use of this source code is governed by the Apache License 2.0
+// license that can be found in the LICENSE file.
+
+package libhoney
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTxDefaultClientSendsBatchAndRoutesResponses(t *testing.T) {
+	var gotPath, gotTeam string
+	var gotBatch []eventOnWire
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotTeam = r.Header.Get("X-Honeycomb-Team")
+		if err := json.NewDecoder(r.Body).Decode(&gotBatch); err != nil {
+			t.Errorf("decoding request body: %v", err)
+		}
+		w.Write([]byte(`[{"status":202},{"status":400,"error":"bad widget"}]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(Config{
+		WriteKey:      "wk",
+		Dataset:       "ds",
+		APIHost:       ts.URL,
+		MaxBatchSize:  2,
+		SendFrequency: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	ev1 := c.NewEvent()
+	ev1.Metadata = "first"
+	ev1.AddField("widgets", 1)
+	if err := ev1.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	ev2 := c.NewEvent()
+	ev2.Metadata = "second"
+	ev2.AddField("widgets", 2)
+	if err := ev2.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	responses := c.Responses()
+	seen := map[interface{}]Response{}
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-responses:
+			seen[r.Metadata] = r
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for response %d", i)
+		}
+	}
+	c.Close()
+
+	if gotPath != "/1/batch/ds" {
+		t.Errorf("got request path %q, want /1/batch/ds", gotPath)
+	}
+	if gotTeam != "wk" {
+		t.Errorf("got X-Honeycomb-Team %q, want wk", gotTeam)
+	}
+	if len(gotBatch) != 2 {
+		t.Fatalf("server saw %d events in batch, want 2", len(gotBatch))
+	}
+
+	if r := seen["first"]; r.StatusCode != 202 || r.Err != nil {
+		t.Errorf("first event: got status=%d err=%v, want 202/nil", r.StatusCode, r.Err)
+	}
+	if r := seen["second"]; r.StatusCode != 400 || r.Err == nil {
+		t.Errorf("second event: got status=%d err=%v, want 400/non-nil", r.StatusCode, r.Err)
+	}
+}
+
+func TestTxDefaultClientEscapesDatasetInBatchURL(t *testing.T) {
+	var gotPath string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.Write([]byte(`[{"status":202}]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(Config{
+		WriteKey:      "wk",
+		Dataset:       "my app/prod",
+		APIHost:       ts.URL,
+		SendFrequency: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	ev := c.NewEvent()
+	ev.AddField("widgets", 1)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	select {
+	case <-c.Responses():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for response")
+	}
+	c.Close()
+
+	if want := "/1/batch/my%20app%2Fprod"; gotPath != want {
+		t.Errorf("got request path %q, want %q", gotPath, want)
+	}
+}
+
+func TestTxDefaultClientRetriesOn5xx(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"status":202}]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(Config{
+		WriteKey:      "wk",
+		Dataset:       "ds",
+		APIHost:       ts.URL,
+		MaxBatchSize:  1,
+		SendFrequency: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	ev := c.NewEvent()
+	ev.Metadata = "retried"
+	ev.AddField("widgets", 1)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	select {
+	case r := <-c.Responses():
+		if r.Err != nil {
+			t.Errorf("got err %v, want nil after retry succeeded", r.Err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for response")
+	}
+	c.Close()
+
+	if attempts < 2 {
+		t.Errorf("got %d attempts, want at least 2 (one failure, one retry)", attempts)
+	}
+}
+
+func TestTxDefaultClientDoesNotRetry4xx(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(Config{
+		WriteKey:      "wk",
+		Dataset:       "ds",
+		APIHost:       ts.URL,
+		MaxBatchSize:  1,
+		SendFrequency: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	ev := c.NewEvent()
+	ev.Metadata = "rejected"
+	ev.AddField("widgets", 1)
+	if err := ev.Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	select {
+	case r := <-c.Responses():
+		if r.Err == nil {
+			t.Errorf("got nil err, want the 400 to surface")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for response")
+	}
+	c.Close()
+
+	if attempts != 1 {
+		t.Errorf("got %d attempts for a non-retryable 400, want exactly 1", attempts)
+	}
+}